@@ -10,38 +10,47 @@
 package stack
 
 import (
+	"encoding/json"
 	"fmt"
+	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
-// Call records a single function invocation from a goroutine stack.
+// Call records a single function invocation from a goroutine stack. It is
+// resolved through runtime.CallersFrames, so a function inlined by the
+// compiler gets its own Call rather than being collapsed into its caller's.
 type Call struct {
-	fn *runtime.Func
-	pc uintptr
+	frame runtime.Frame
 }
 
 // Caller returns a Call from the stack of the current goroutine. The argument
 // skip is the number of stack frames to ascend, with 0 identifying the
 // calling function.
 func Caller(skip int) Call {
-	var pcs [2]uintptr
-	n := runtime.Callers(skip+1, pcs[:])
+	var pcs [1]uintptr
+	n := runtime.Callers(skip+2, pcs[:])
 
-	var c Call
-
-	if n < 2 {
-		return c
+	if n == 0 {
+		return Call{}
 	}
 
-	c.pc = pcs[1]
-	if runtime.FuncForPC(pcs[0]) != sigpanic {
-		c.pc--
-	}
-	c.fn = runtime.FuncForPC(c.pc)
-	return c
+	frame, _ := runtime.CallersFrames(pcs[:n]).Next()
+	return Call{frame: frame}
+}
+
+// CallersFrames returns the runtime.Frames iterator for the stack of the
+// current goroutine so that callers can stream frames - including ones the
+// compiler inlined - without the allocation of resolving a full CallStack.
+// The argument skip is the number of stack frames to ascend, with 0
+// identifying the calling function.
+func CallersFrames(skip int) *runtime.Frames {
+	pcs := make([]uintptr, 1000)
+	n := runtime.Callers(skip+2, pcs)
+	return runtime.CallersFrames(pcs[:n])
 }
 
 // Format implements fmt.Formatter with support for the following verbs.
@@ -59,14 +68,14 @@ func Caller(skip int) Call {
 //    %+v   equivalent to %+s:%d
 //    %#v   equivalent to %#s:%d
 func (c Call) Format(s fmt.State, verb rune) {
-	if c.fn == nil {
+	if c.frame.PC == 0 {
 		fmt.Fprintf(s, "%%!%c(NOFUNC)", verb)
 		return
 	}
 
 	switch verb {
 	case 's', 'v':
-		file, line := c.fn.FileLine(uintptr(c.pc))
+		file := c.frame.File
 		switch {
 		case s.Flag('#'):
 			// done
@@ -74,25 +83,25 @@ func (c Call) Format(s fmt.State, verb rune) {
 			// Here we want to get the source file path relative to the
 			// compile time GOPATH. As of Go 1.4.x there is no direct way to
 			// know the compiled GOPATH at runtime, but we can infer the
-			// number of path segments in the GOPATH. We note that fn.Name()
-			// returns the function name qualified by the import path, which
-			// does not include the GOPATH. Thus we can trim segments from the
+			// number of path segments in the GOPATH. We note that
+			// frame.Function is qualified by the import path, which does not
+			// include the GOPATH. Thus we can trim segments from the
 			// beginning of the file path until the number of path separators
-			// remaining is one more than the number of path separators in the
-			// function name. For example, given:
+			// remaining is one more than the number of path separators in
+			// the function name. For example, given:
 			//
-			//    GOPATH     /home/user
-			//    file       /home/user/src/pkg/sub/file.go
-			//    fn.Name()  pkg/sub.Type.Method
+			//    GOPATH            /home/user
+			//    file              /home/user/src/pkg/sub/file.go
+			//    frame.Function    pkg/sub.Type.Method
 			//
 			// We want to produce:
 			//
 			//    pkg/sub/file.go
 			//
-			// From this we can easily see that fn.Name() has one less path
-			// separator than our desired output.
+			// From this we can easily see that frame.Function has one less
+			// path separator than our desired output.
 			const sep = "/"
-			impCnt := strings.Count(c.fn.Name(), sep) + 1
+			impCnt := strings.Count(c.frame.Function, sep) + 1
 			pathCnt := strings.Count(file, sep)
 			for pathCnt > impCnt {
 				i := strings.Index(file, sep)
@@ -110,15 +119,14 @@ func (c Call) Format(s fmt.State, verb rune) {
 		}
 		fmt.Fprint(s, file)
 		if verb == 'v' {
-			fmt.Fprint(s, ":", line)
+			fmt.Fprint(s, ":", c.frame.Line)
 		}
 
 	case 'd':
-		_, line := c.fn.FileLine(uintptr(c.pc))
-		fmt.Fprint(s, line)
+		fmt.Fprint(s, c.frame.Line)
 
 	case 'n':
-		name := c.fn.Name()
+		name := c.frame.Function
 		if !s.Flag('+') {
 			const pathSep = "/"
 			if i := strings.LastIndex(name, pathSep); i != -1 {
@@ -136,32 +144,128 @@ func (c Call) Format(s fmt.State, verb rune) {
 // name returns the import path qualified name of the function containing the
 // call.
 func (c Call) name() string {
-	if c.fn == nil {
+	if c.frame.PC == 0 {
 		return "???"
 	}
-	return c.fn.Name()
+	return c.frame.Function
 }
 
 func (c Call) file() string {
-	if c.fn == nil {
+	if c.frame.PC == 0 {
 		return "???"
 	}
-	file, _ := c.fn.FileLine(uintptr(c.pc))
-	return file
+	return c.frame.File
 }
 
 func (c Call) line() int {
-	if c.fn == nil {
+	if c.frame.PC == 0 {
 		return 0
 	}
-	_, line := c.fn.FileLine(c.pc)
-	return line
+	return c.frame.Line
+}
+
+// identity returns the values that uniquely locate the frame within the
+// binary: the entry point of the function together with the file and line of
+// the call within it. Two Calls that refer to the same invocation share an
+// identity even when their PCs differ, which happens once inlining is in
+// play.
+func (c Call) identity() (uintptr, string, int) {
+	return c.frame.Entry, c.frame.File, c.frame.Line
+}
+
+func (c Call) equal(o Call) bool {
+	cEntry, cFile, cLine := c.identity()
+	oEntry, oFile, oLine := o.identity()
+	return cEntry == oEntry && cFile == oFile && cLine == oLine
+}
+
+// JSONPathMode selects how a Call's source file is rendered by MarshalJSON
+// and LogValue. It mirrors the path styles already reachable through the
+// '+' and '#' Format flags.
+type JSONPathMode int
+
+// The supported JSONPathMode values.
+const (
+	// PathShort renders only the file's base name, as %s does.
+	PathShort JSONPathMode = iota
+	// PathGOPATHRelative renders the file relative to the compile time
+	// GOPATH, as %+s does.
+	PathGOPATHRelative
+	// PathFull renders the file's full path, as %#s does.
+	PathFull
+)
+
+var jsonPathMode int32 // holds a JSONPathMode, accessed via sync/atomic
+
+// SetJSONPathMode sets the JSONPathMode used by MarshalJSON and LogValue to
+// render a Call's file path. It defaults to PathShort.
+func SetJSONPathMode(mode JSONPathMode) {
+	atomic.StoreInt32(&jsonPathMode, int32(mode))
+}
+
+func currentJSONPathMode() JSONPathMode {
+	return JSONPathMode(atomic.LoadInt32(&jsonPathMode))
+}
+
+// path renders c's source file according to mode, using the same rules as
+// the '+' and '#' Format flags.
+func (c Call) path(mode JSONPathMode) string {
+	const sep = "/"
+	file := c.frame.File
+	switch mode {
+	case PathFull:
+		return file
+	case PathGOPATHRelative:
+		impCnt := strings.Count(c.frame.Function, sep) + 1
+		pathCnt := strings.Count(file, sep)
+		for pathCnt > impCnt {
+			i := strings.Index(file, sep)
+			if i == -1 {
+				break
+			}
+			file = file[i+len(sep):]
+			pathCnt--
+		}
+		return file
+	default: // PathShort
+		if i := strings.LastIndex(file, sep); i != -1 {
+			file = file[i+len(sep):]
+		}
+		return file
+	}
+}
+
+// jsonCall is the wire representation produced by Call.MarshalJSON.
+type jsonCall struct {
+	Func string `json:"func"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// MarshalJSON implements json.Marshaler, rendering c as
+// {"func":..., "file":..., "line":...}. The file path style is controlled by
+// SetJSONPathMode.
+func (c Call) MarshalJSON() ([]byte, error) {
+	if c.frame.PC == 0 {
+		return json.Marshal(jsonCall{})
+	}
+	return json.Marshal(jsonCall{
+		Func: c.frame.Function,
+		File: c.path(currentJSONPathMode()),
+		Line: c.frame.Line,
+	})
 }
 
 // CallStack records a sequence of function invocations from a goroutine
 // stack.
 type CallStack []Call
 
+// MarshalJSON implements json.Marshaler, rendering cs as a JSON array of the
+// objects produced by Call.MarshalJSON.
+func (cs CallStack) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]Call(cs))
+}
+
 // Format implements fmt.Formatter by printing the CallStack as square brackes
 // ([, ]) surrounding a space separated list of Calls each formatted with the
 // supplied verb and options.
@@ -176,67 +280,34 @@ func (cs CallStack) Format(s fmt.State, verb rune) {
 	s.Write([]byte("]"))
 }
 
-// findSigpanic intentially executes faulting code to generate a stack trace
-// containing an entry for runtime.sigpanic.
-func findSigpanic() *runtime.Func {
-	var fn *runtime.Func
-	func() int {
-		defer func() {
-			if p := recover(); p != nil {
-				pcs := pcStackPool.Get().([]uintptr)
-				pcs = pcs[:cap(pcs)]
-				n := runtime.Callers(2, pcs)
-				for _, pc := range pcs[:n] {
-					f := runtime.FuncForPC(pc)
-					if f.Name() == "runtime.sigpanic" {
-						fn = f
-						break
-					}
-				}
-				pcStackPool.Put(pcs)
-			}
-		}()
-		// intentional division by zero fault
-		a, b := 1, 0
-		return a / b
-	}()
-	return fn
-}
-
-var (
-	sigpanic *runtime.Func
-	spOnce   sync.Once
-)
-
 var pcStackPool = sync.Pool{
 	New: func() interface{} { return make([]uintptr, 1000) },
 }
 
 // Trace returns a CallStack for the current goroutine with element 0
-// identifying the calling function.
+// identifying the calling function. Frames the compiler inlined are resolved
+// through runtime.CallersFrames, so each inlined call contributes its own
+// Call instead of being reported under its enclosing function's name.
 func Trace() CallStack {
-	spOnce.Do(func() {
-		sigpanic = findSigpanic()
-	})
-
 	pcs := pcStackPool.Get().([]uintptr)
 	pcs = pcs[:cap(pcs)]
 
 	n := runtime.Callers(2, pcs)
-	cs := make([]Call, n)
 
-	for i, pc := range pcs[:n] {
-		pcFix := pc
-		if i > 0 && cs[i-1].fn != sigpanic {
-			pcFix--
-		}
-		cs[i] = Call{
-			fn: runtime.FuncForPC(pcFix),
-			pc: pcFix,
+	var cs CallStack
+	if n > 0 {
+		frames := runtime.CallersFrames(pcs[:n])
+		cs = make(CallStack, 0, n)
+		for {
+			frame, more := frames.Next()
+			cs = append(cs, Call{frame: frame})
+			if !more {
+				break
+			}
 		}
 	}
 
-	pcStackPool.Put(pcs)
+	pcStackPool.Put(pcs[:cap(pcs)])
 
 	return cs
 }
@@ -244,7 +315,7 @@ func Trace() CallStack {
 // TrimBelow returns a slice of the CallStack with all entries below c
 // removed.
 func (cs CallStack) TrimBelow(c Call) CallStack {
-	for len(cs) > 0 && cs[0].pc != c.pc {
+	for len(cs) > 0 && !cs[0].equal(c) {
 		cs = cs[1:]
 	}
 	return cs
@@ -253,7 +324,7 @@ func (cs CallStack) TrimBelow(c Call) CallStack {
 // TrimAbove returns a slice of the CallStack with all entries above c
 // removed.
 func (cs CallStack) TrimAbove(c Call) CallStack {
-	for len(cs) > 0 && cs[len(cs)-1].pc != c.pc {
+	for len(cs) > 0 && !cs[len(cs)-1].equal(c) {
 		cs = cs[:len(cs)-1]
 	}
 	return cs
@@ -284,3 +355,81 @@ func (cs CallStack) TrimRuntime() CallStack {
 	}
 	return cs
 }
+
+// Filter returns a slice of the CallStack containing only the Calls for
+// which keep returns true, preserving order.
+func (cs CallStack) Filter(keep func(Call) bool) CallStack {
+	out := make(CallStack, 0, len(cs))
+	for _, c := range cs {
+		if keep(c) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// TrimBelowFunc returns a slice of the CallStack with all entries below the
+// first Call for which pred returns true removed.
+func (cs CallStack) TrimBelowFunc(pred func(Call) bool) CallStack {
+	for len(cs) > 0 && !pred(cs[0]) {
+		cs = cs[1:]
+	}
+	return cs
+}
+
+// TrimAboveFunc returns a slice of the CallStack with all entries above the
+// last Call for which pred returns true removed.
+func (cs CallStack) TrimAboveFunc(pred func(Call) bool) CallStack {
+	for len(cs) > 0 && !pred(cs[len(cs)-1]) {
+		cs = cs[:len(cs)-1]
+	}
+	return cs
+}
+
+// packagePath returns the import path portion of an import-qualified
+// function name such as "pkg/sub.Type.Method", i.e. "pkg/sub".
+func packagePath(funcName string) string {
+	const sep = "/"
+	prefix, rest := "", funcName
+	if i := strings.LastIndex(funcName, sep); i != -1 {
+		prefix, rest = funcName[:i+1], funcName[i+1:]
+	}
+	if i := strings.Index(rest, "."); i != -1 {
+		rest = rest[:i]
+	}
+	return prefix + rest
+}
+
+// InPackage returns a predicate matching Calls whose function is declared
+// directly in importPath.
+func InPackage(importPath string) func(Call) bool {
+	return func(c Call) bool {
+		return packagePath(c.name()) == importPath
+	}
+}
+
+// InModule returns a predicate matching Calls whose function is declared in
+// modulePath or in a package nested under it.
+func InModule(modulePath string) func(Call) bool {
+	return func(c Call) bool {
+		pkg := packagePath(c.name())
+		return pkg == modulePath || strings.HasPrefix(pkg, modulePath+"/")
+	}
+}
+
+// MatchFunc returns a predicate matching Calls whose import path qualified
+// function name matches the glob pattern, using the syntax of path.Match.
+func MatchFunc(pattern string) func(Call) bool {
+	return func(c Call) bool {
+		ok, err := path.Match(pattern, c.name())
+		return err == nil && ok
+	}
+}
+
+// InGoroot returns a predicate matching Calls originating from files under
+// GOROOT, i.e. the go runtime and standard library.
+func InGoroot() func(Call) bool {
+	return func(c Call) bool {
+		return inGoroot(c.file())
+	}
+}
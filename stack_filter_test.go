@@ -0,0 +1,119 @@
+package stack
+
+import "testing"
+
+func TestPackagePath(t *testing.T) {
+	tests := []struct {
+		funcName string
+		want     string
+	}{
+		{"github.com/go-stack/stack.Trace", "github.com/go-stack/stack"},
+		{"github.com/go-stack/stack.(*LazyStack).Release", "github.com/go-stack/stack"},
+		{"github.com/go-stack/stack.CallStack.Filter", "github.com/go-stack/stack"},
+		{"main.main", "main"},
+	}
+	for _, tt := range tests {
+		if got := packagePath(tt.funcName); got != tt.want {
+			t.Errorf("packagePath(%q) = %q, want %q", tt.funcName, got, tt.want)
+		}
+	}
+}
+
+func TestInPackage(t *testing.T) {
+	cs := Trace()
+	pred := InPackage(packagePath(cs[0].name()))
+	if !pred(cs[0]) {
+		t.Errorf("InPackage(own package) did not match the calling frame")
+	}
+	if pred(Call{}) {
+		t.Errorf("InPackage matched a zero-value Call")
+	}
+}
+
+func TestInModule(t *testing.T) {
+	cs := Trace()
+	pkg := packagePath(cs[0].name())
+	pred := InModule(pkg)
+	if !pred(cs[0]) {
+		t.Errorf("InModule(own package) did not match the calling frame")
+	}
+	if !InModule("github.com/go-stack")(cs[0]) {
+		t.Errorf("InModule of a parent path did not match a nested package frame")
+	}
+	if InModule("github.com/go-stack/stackwrong")(cs[0]) {
+		t.Errorf("InModule matched an unrelated sibling path")
+	}
+}
+
+func TestMatchFunc(t *testing.T) {
+	// path.Match's '*' does not cross '/', so a pattern over an
+	// import-qualified name needs to either spell out the full path or
+	// glob only within the trailing, slash-free segment.
+	cs := Trace()
+	pkg := packagePath(cs[0].name())
+
+	if !MatchFunc(pkg + ".*")(cs[0]) {
+		t.Errorf("MatchFunc(%q) did not match the calling frame, name = %q", pkg+".*", cs[0].name())
+	}
+	if MatchFunc(pkg + ".NoSuchFunc")(cs[0]) {
+		t.Errorf("MatchFunc(%q) unexpectedly matched %q", pkg+".NoSuchFunc", cs[0].name())
+	}
+}
+
+func TestInGoroot(t *testing.T) {
+	pred := InGoroot()
+	cs := Trace().TrimRuntime()
+	if len(cs) == 0 {
+		t.Fatal("TrimRuntime removed every frame")
+	}
+	if pred(cs[0]) {
+		t.Errorf("InGoroot matched %v, a frame from this package", cs[0])
+	}
+
+	full := Trace()
+	if len(full) <= len(cs) {
+		t.Skip("no runtime frames captured above the test frame to check InGoroot against")
+	}
+	if !pred(full[len(full)-1]) {
+		t.Errorf("InGoroot did not match %v, the topmost runtime frame", full[len(full)-1])
+	}
+}
+
+func TestFilter(t *testing.T) {
+	cs := Trace()
+	pkg := packagePath(cs[0].name())
+
+	kept := cs.Filter(InPackage(pkg))
+	if len(kept) == 0 {
+		t.Fatal("Filter(InPackage(own package)) removed everything")
+	}
+	for _, c := range kept {
+		if packagePath(c.name()) != pkg {
+			t.Errorf("Filter kept a frame outside %q: %v", pkg, c)
+		}
+	}
+
+	none := cs.Filter(func(Call) bool { return false })
+	if len(none) != 0 {
+		t.Errorf("Filter(always-false) = %v, want empty", none)
+	}
+}
+
+func TestTrimBelowAboveFunc(t *testing.T) {
+	cs := Trace()
+	if len(cs) < 2 {
+		t.Fatal("need at least two frames in the captured stack")
+	}
+	mid := cs[len(cs)/2]
+	pred := func(c Call) bool { return c.equal(mid) }
+
+	below := cs.TrimBelowFunc(pred)
+	if len(below) == 0 || !below[0].equal(mid) {
+		t.Errorf("TrimBelowFunc(pred) = %v, want first entry to equal mid", below)
+	}
+
+	above := cs.TrimAboveFunc(pred)
+	if len(above) == 0 || !above[len(above)-1].equal(mid) {
+		t.Errorf("TrimAboveFunc(pred) = %v, want last entry to equal mid", above)
+	}
+}
@@ -0,0 +1,97 @@
+package stack
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type jsonCallWant struct {
+	Func string `json:"func"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+func TestCallMarshalJSONRoundTrip(t *testing.T) {
+	c := Caller(0)
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var got jsonCallWant
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	if got.Func != c.name() {
+		t.Errorf("func = %q, want %q", got.Func, c.name())
+	}
+	if got.Line != c.line() {
+		t.Errorf("line = %d, want %d", got.Line, c.line())
+	}
+
+	iFunc := strings.Index(string(b), `"func"`)
+	iFile := strings.Index(string(b), `"file"`)
+	iLine := strings.Index(string(b), `"line"`)
+	if !(iFunc >= 0 && iFunc < iFile && iFile < iLine) {
+		t.Errorf("key order = %s, want func, file, line", b)
+	}
+}
+
+func TestCallStackMarshalJSONRoundTrip(t *testing.T) {
+	cs := Trace()
+
+	b, err := json.Marshal(cs)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var got []jsonCallWant
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	if len(got) != len(cs) {
+		t.Fatalf("len(got) = %d, want %d", len(got), len(cs))
+	}
+	for i, c := range cs {
+		if got[i].Func != c.name() || got[i].Line != c.line() {
+			t.Errorf("entry %d = %+v, want func=%q line=%d", i, got[i], c.name(), c.line())
+		}
+	}
+}
+
+func TestCallMarshalJSONPathMode(t *testing.T) {
+	defer SetJSONPathMode(PathShort)
+
+	c := Caller(0)
+
+	SetJSONPathMode(PathFull)
+	full, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	SetJSONPathMode(PathShort)
+	short, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var fullGot, shortGot jsonCallWant
+	if err := json.Unmarshal(full, &fullGot); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if err := json.Unmarshal(short, &shortGot); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	if !strings.HasSuffix(fullGot.File, shortGot.File) {
+		t.Errorf("PathFull file %q does not end with PathShort file %q", fullGot.File, shortGot.File)
+	}
+	if fullGot.File == shortGot.File {
+		t.Errorf("PathFull and PathShort produced the same file %q", fullGot.File)
+	}
+}
@@ -0,0 +1,97 @@
+package stack
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// TraceN returns a CallStack for the current goroutine with element 0
+// identifying the calling function, the same as Trace, but captures at most
+// maxDepth frames instead of the package default of 1000.
+func TraceN(maxDepth int) CallStack {
+	pcs := make([]uintptr, maxDepth)
+	n := runtime.Callers(2, pcs)
+	return framesToCallStack(runtime.CallersFrames(pcs[:n]), n)
+}
+
+// CallerN returns a CallStack of at most n frames from the stack of the
+// current goroutine, ascending skip frames before it starts capturing, with
+// skip 0 identifying the calling function.
+func CallerN(skip, n int) CallStack {
+	pcs := make([]uintptr, n)
+	cnt := runtime.Callers(skip+2, pcs)
+	return framesToCallStack(runtime.CallersFrames(pcs[:cnt]), cnt)
+}
+
+func framesToCallStack(frames *runtime.Frames, hint int) CallStack {
+	if hint == 0 {
+		return nil
+	}
+	cs := make(CallStack, 0, hint)
+	for {
+		frame, more := frames.Next()
+		cs = append(cs, Call{frame: frame})
+		if !more {
+			break
+		}
+	}
+	return cs
+}
+
+// LazyStack holds the raw program counters of a captured stack without
+// resolving any of them into Calls. Resolution happens on demand when the
+// LazyStack is formatted, so a caller that only prints the top few frames of
+// a deep stack never pays to resolve the rest.
+//
+// A LazyStack obtained from Lazy holds pooled memory; call Release once it
+// is no longer needed to return that memory for reuse.
+type LazyStack struct {
+	pcs []uintptr
+}
+
+// Lazy returns a LazyStack for the current goroutine with element 0
+// identifying the calling function.
+func Lazy() LazyStack {
+	pcs := pcStackPool.Get().([]uintptr)
+	pcs = pcs[:cap(pcs)]
+
+	n := runtime.Callers(2, pcs)
+
+	return LazyStack{pcs: pcs[:n]}
+}
+
+// Release returns the LazyStack's backing memory to the package pool. The
+// LazyStack must not be used after calling Release.
+func (ls LazyStack) Release() {
+	if ls.pcs == nil {
+		return
+	}
+	pcStackPool.Put(ls.pcs[:cap(ls.pcs)])
+}
+
+// Format implements fmt.Formatter identically to CallStack.Format, except
+// that frames are resolved one at a time through runtime.CallersFrames as
+// the format consumes them. A precision, e.g. "%.3v", bounds how many
+// frames are resolved; without one every frame is resolved, just as with
+// CallStack.
+func (ls LazyStack) Format(s fmt.State, verb rune) {
+	limit := -1
+	if p, ok := s.Precision(); ok {
+		limit = p
+	}
+
+	frames := runtime.CallersFrames(ls.pcs)
+
+	s.Write([]byte("["))
+	for i := 0; len(ls.pcs) > 0 && (limit < 0 || i < limit); i++ {
+		frame, more := frames.Next()
+		if i > 0 {
+			s.Write([]byte(" "))
+		}
+		Call{frame: frame}.Format(s, verb)
+		if !more {
+			break
+		}
+	}
+	s.Write([]byte("]"))
+}
@@ -0,0 +1,109 @@
+package stack
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func deepCall(depth int, f func()) {
+	if depth == 0 {
+		f()
+		return
+	}
+	deepCall(depth-1, f)
+}
+
+func TestTraceNBoundsDepth(t *testing.T) {
+	cs := TraceN(2)
+	if len(cs) == 0 || len(cs) > 2 {
+		t.Errorf("TraceN(2) returned %d frames, want 1 or 2", len(cs))
+	}
+	if got := TraceN(0); len(got) != 0 {
+		t.Errorf("TraceN(0) = %v, want empty", got)
+	}
+}
+
+func TestCallerNBoundsDepth(t *testing.T) {
+	cs := CallerN(0, 2)
+	if len(cs) == 0 || len(cs) > 2 {
+		t.Errorf("CallerN(0, 2) returned %d frames, want 1 or 2", len(cs))
+	}
+	if got := CallerN(0, 0); got != nil {
+		t.Errorf("CallerN(0, 0) = %v, want nil", got)
+	}
+}
+
+func TestLazyStackFormatMatchesCallStack(t *testing.T) {
+	ls := Lazy()
+	defer ls.Release()
+
+	pcs := append([]uintptr(nil), ls.pcs...)
+	full := framesToCallStack(runtime.CallersFrames(pcs), len(pcs))
+	if len(full) < 2 {
+		t.Fatal("need at least two frames in the captured stack")
+	}
+
+	for _, n := range []int{1, 2, len(full)} {
+		want := fmt.Sprintf("%v", full[:n])
+		got := fmt.Sprintf("%.*v", n, ls)
+		if got != want {
+			t.Errorf("%%.%dv = %q, want %q", n, got, want)
+		}
+	}
+
+	if got, want := fmt.Sprintf("%v", ls), fmt.Sprintf("%v", full); got != want {
+		t.Errorf("%%v (no precision) = %q, want %q", got, want)
+	}
+}
+
+func TestLazyStackReleaseAllowsReuseWithoutCorruption(t *testing.T) {
+	ls1 := Lazy()
+	ls1.Release()
+
+	ls2 := Lazy()
+	defer ls2.Release()
+
+	pcs := append([]uintptr(nil), ls2.pcs...)
+	full := framesToCallStack(runtime.CallersFrames(pcs), len(pcs))
+	if len(full) == 0 {
+		t.Fatal("Lazy() after a Release returned no frames")
+	}
+	if !strings.HasSuffix(full[0].name(), "TestLazyStackReleaseAllowsReuseWithoutCorruption") {
+		t.Errorf("top frame = %q, want suffix %q", full[0].name(), "TestLazyStackReleaseAllowsReuseWithoutCorruption")
+	}
+}
+
+// BenchmarkTrace_ShallowPrint resolves the full stack up front via Trace,
+// then only ever prints the top 3 frames.
+func BenchmarkTrace_ShallowPrint(b *testing.B) {
+	b.ReportAllocs()
+	deepCall(50, func() {
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			cs := Trace()
+			fmt.Fprintf(ioDiscard{}, "%.3v", cs[:3])
+		}
+	})
+}
+
+// BenchmarkLazy_ShallowPrint only resolves the frames it actually prints,
+// via LazyStack's on-demand resolution.
+func BenchmarkLazy_ShallowPrint(b *testing.B) {
+	b.ReportAllocs()
+	deepCall(50, func() {
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			ls := Lazy()
+			fmt.Fprintf(ioDiscard{}, "%.3v", ls)
+			ls.Release()
+		}
+	})
+}
+
+// ioDiscard is a minimal io.Writer that throws away everything written to
+// it, avoiding an import of io/ioutil or os for a benchmark sink.
+type ioDiscard struct{}
+
+func (ioDiscard) Write(p []byte) (int, error) { return len(p), nil }
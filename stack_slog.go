@@ -0,0 +1,33 @@
+//go:build go1.21
+
+package stack
+
+import (
+	"log/slog"
+	"strconv"
+)
+
+// LogValue implements slog.LogValuer, rendering c as a structured group with
+// "func", "file", and "line" attributes. The file path style is controlled
+// by SetJSONPathMode.
+func (c Call) LogValue() slog.Value {
+	if c.frame.PC == 0 {
+		return slog.Value{}
+	}
+	return slog.GroupValue(
+		slog.String("func", c.frame.Function),
+		slog.String("file", c.path(currentJSONPathMode())),
+		slog.Int("line", c.frame.Line),
+	)
+}
+
+// LogValue implements slog.LogValuer, rendering cs as a group of its Calls
+// indexed by position so a CallStack can be passed directly to
+// slog.Any("stack", stack.Trace()).
+func (cs CallStack) LogValue() slog.Value {
+	attrs := make([]slog.Attr, len(cs))
+	for i, c := range cs {
+		attrs[i] = slog.Any(strconv.Itoa(i), c)
+	}
+	return slog.GroupValue(attrs...)
+}
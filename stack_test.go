@@ -0,0 +1,101 @@
+package stack
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCaller(t *testing.T) {
+	c := Caller(0)
+	if c.frame.PC == 0 {
+		t.Fatal("Caller(0) returned a zero Call")
+	}
+	if !strings.HasSuffix(c.name(), "TestCaller") {
+		t.Errorf("name = %q, want suffix %q", c.name(), "TestCaller")
+	}
+	if !strings.HasSuffix(c.file(), "stack_test.go") {
+		t.Errorf("file = %q, want suffix %q", c.file(), "stack_test.go")
+	}
+}
+
+func callerAt(skip int) Call { return Caller(skip) }
+
+func TestCallerSkipAscends(t *testing.T) {
+	c := callerAt(1)
+	if !strings.HasSuffix(c.name(), "TestCallerSkipAscends") {
+		t.Errorf("name = %q, want skip=1 to resolve to the caller of callerAt", c.name())
+	}
+}
+
+func TestTraceNoBogusEmptyFrame(t *testing.T) {
+	cs := Trace()
+	if len(cs) == 0 {
+		t.Fatal("Trace returned an empty CallStack")
+	}
+	for i, c := range cs {
+		if c.frame.PC == 0 {
+			t.Errorf("entry %d is a bogus zero-value frame", i)
+		}
+	}
+	if !strings.HasSuffix(cs[0].name(), "TestTraceNoBogusEmptyFrame") {
+		t.Errorf("cs[0].name() = %q, want the calling test function", cs[0].name())
+	}
+}
+
+func sameSite() Call { return Caller(0) }
+
+func TestCallEqualByIdentityNotPC(t *testing.T) {
+	// equal must compare by frame identity (function entry, file, line)
+	// rather than by raw pc, since inlining can give two Calls that
+	// describe the same logical invocation different pcs.
+	a := sameSite()
+	b := sameSite()
+	if !a.equal(b) {
+		t.Errorf("two Callers captured at the same call site should be equal")
+	}
+
+	other := Caller(0)
+	if a.equal(other) {
+		t.Errorf("Callers from different call sites should not be equal")
+	}
+}
+
+func TestTrimBelowAbove(t *testing.T) {
+	cs := Trace()
+	if len(cs) < 2 {
+		t.Fatal("need at least two frames in the captured stack")
+	}
+	mid := cs[len(cs)/2]
+
+	below := cs.TrimBelow(mid)
+	if len(below) == 0 || !below[0].equal(mid) {
+		t.Errorf("TrimBelow(mid) = %v, want first entry to equal mid", below)
+	}
+
+	above := cs.TrimAbove(mid)
+	if len(above) == 0 || !above[len(above)-1].equal(mid) {
+		t.Errorf("TrimAbove(mid) = %v, want last entry to equal mid", above)
+	}
+}
+
+func TestCallFormatVerbs(t *testing.T) {
+	c := Caller(0)
+
+	if got, want := fmt.Sprintf("%d", c), strconv.Itoa(c.line()); got != want {
+		t.Errorf("%%d = %q, want %q", got, want)
+	}
+
+	if got := fmt.Sprintf("%s", c); got != "stack_test.go" {
+		t.Errorf("%%s = %q, want %q", got, "stack_test.go")
+	}
+
+	if got, want := fmt.Sprintf("%n", c), "TestCallFormatVerbs"; got != want {
+		t.Errorf("%%n = %q, want %q", got, want)
+	}
+
+	if got := fmt.Sprintf("%+n", c); !strings.HasSuffix(got, ".TestCallFormatVerbs") {
+		t.Errorf("%%+n = %q, want import path qualified name ending in .TestCallFormatVerbs", got)
+	}
+}
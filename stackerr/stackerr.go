@@ -0,0 +1,158 @@
+// Package stackerr augments error values with the call stack captured at the
+// point they were created, in the spirit of github.com/pkg/errors. It builds
+// directly on the stack.Call/stack.CallStack types from the parent package
+// rather than maintaining its own frame representation.
+//
+// The package is named stackerr rather than errors so that it can be
+// imported alongside the standard library errors package - which its
+// errors participate in via the standard unwrap chain, so errors.Is,
+// errors.As, and errors.Unwrap work as expected - without forcing an import
+// alias on every caller.
+package stackerr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	stack "github.com/go-stack/stack"
+)
+
+// New returns an error with the supplied message and a CallStack captured at
+// the call site.
+func New(msg string) error {
+	return &fundamental{
+		msg:   msg,
+		stack: stack.Trace().TrimRuntime(),
+	}
+}
+
+// Errorf formats according to the given format specifier and returns an
+// error with a CallStack captured at the call site, analogous to
+// fmt.Errorf.
+func Errorf(format string, args ...interface{}) error {
+	return &fundamental{
+		msg:   fmt.Sprintf(format, args...),
+		stack: stack.Trace().TrimRuntime(),
+	}
+}
+
+// fundamental is an error that carries a message and a stack but no cause.
+type fundamental struct {
+	msg   string
+	stack stack.CallStack
+}
+
+func (f *fundamental) Error() string { return f.msg }
+
+func (f *fundamental) StackTrace() stack.CallStack { return f.stack }
+
+func (f *fundamental) Format(s fmt.State, verb rune) {
+	formatWithStack(s, verb, f.msg, f.stack)
+}
+
+// WithStack attaches a CallStack captured at the call site to err without
+// altering its message. It returns nil if err is nil.
+func WithStack(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &withStack{
+		cause: err,
+		stack: stack.Trace().TrimRuntime(),
+	}
+}
+
+// withStack pairs a cause with a CallStack captured when the cause was
+// wrapped.
+type withStack struct {
+	cause error
+	stack stack.CallStack
+}
+
+func (w *withStack) Error() string { return w.cause.Error() }
+
+func (w *withStack) Unwrap() error { return w.cause }
+
+func (w *withStack) StackTrace() stack.CallStack { return w.stack }
+
+func (w *withStack) Format(s fmt.State, verb rune) {
+	formatWithStack(s, verb, w.Error(), w.stack)
+}
+
+// Wrap returns an error annotating err with msg and a CallStack captured at
+// the call site. It returns nil if err is nil.
+func Wrap(err error, msg string) error {
+	if err == nil {
+		return nil
+	}
+	return &withStack{
+		cause: &withMessage{cause: err, msg: msg},
+		stack: stack.Trace().TrimRuntime(),
+	}
+}
+
+// Wrapf returns an error annotating err with the message produced by the
+// given format specifier and a CallStack captured at the call site. It
+// returns nil if err is nil.
+func Wrapf(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	return &withStack{
+		cause: &withMessage{cause: err, msg: fmt.Sprintf(format, args...)},
+		stack: stack.Trace().TrimRuntime(),
+	}
+}
+
+// withMessage prepends msg to the message of cause without capturing its own
+// stack; the stack comes from the enclosing withStack.
+type withMessage struct {
+	cause error
+	msg   string
+}
+
+func (w *withMessage) Error() string { return w.msg + ": " + w.cause.Error() }
+
+func (w *withMessage) Unwrap() error { return w.cause }
+
+// stackTracer is implemented by errors that carry a CallStack.
+type stackTracer interface {
+	StackTrace() stack.CallStack
+}
+
+// StackTrace walks the unwrap chain of err and returns the CallStack
+// attached deepest in the chain, i.e. the one closest to where the error
+// was first created. It returns nil if no error in the chain implements
+// stackTracer.
+func StackTrace(err error) stack.CallStack {
+	var cs stack.CallStack
+	for err != nil {
+		if t, ok := err.(stackTracer); ok {
+			cs = t.StackTrace()
+		}
+		err = errors.Unwrap(err)
+	}
+	return cs
+}
+
+// formatWithStack implements the common %v/%+v/%s/%q formatting shared by
+// fundamental and withStack: %+v prints msg followed by the CallStack with
+// one frame per line, while %v, %s, and %q print only msg.
+func formatWithStack(s fmt.State, verb rune, msg string, cs stack.CallStack) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			io.WriteString(s, msg)
+			for _, c := range cs {
+				fmt.Fprintf(s, "\n%+v", c)
+			}
+			return
+		}
+		fallthrough
+	case 's':
+		io.WriteString(s, msg)
+	case 'q':
+		fmt.Fprintf(s, "%q", msg)
+	}
+}
@@ -0,0 +1,135 @@
+package stackerr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNewCapturesStack(t *testing.T) {
+	err := New("boom")
+	if err.Error() != "boom" {
+		t.Errorf("Error() = %q, want %q", err.Error(), "boom")
+	}
+	if st := StackTrace(err); len(st) == 0 {
+		t.Errorf("StackTrace(err) is empty, want a captured stack")
+	}
+}
+
+func TestErrorfCapturesStack(t *testing.T) {
+	err := Errorf("boom %d", 42)
+	if err.Error() != "boom 42" {
+		t.Errorf("Error() = %q, want %q", err.Error(), "boom 42")
+	}
+	if st := StackTrace(err); len(st) == 0 {
+		t.Errorf("StackTrace(err) is empty, want a captured stack")
+	}
+}
+
+func TestWithStackNilShortCircuits(t *testing.T) {
+	if err := WithStack(nil); err != nil {
+		t.Errorf("WithStack(nil) = %v, want nil", err)
+	}
+}
+
+func TestWrapNilShortCircuits(t *testing.T) {
+	if err := Wrap(nil, "msg"); err != nil {
+		t.Errorf("Wrap(nil, ...) = %v, want nil", err)
+	}
+}
+
+func TestWrapfNilShortCircuits(t *testing.T) {
+	if err := Wrapf(nil, "msg %d", 1); err != nil {
+		t.Errorf("Wrapf(nil, ...) = %v, want nil", err)
+	}
+}
+
+func TestWithStackPreservesMessageAndUnwraps(t *testing.T) {
+	cause := errors.New("cause")
+	wrapped := WithStack(cause)
+
+	if wrapped.Error() != "cause" {
+		t.Errorf("Error() = %q, want %q", wrapped.Error(), "cause")
+	}
+	if !errors.Is(wrapped, cause) {
+		t.Errorf("errors.Is(wrapped, cause) = false, want true")
+	}
+	if st := StackTrace(wrapped); len(st) == 0 {
+		t.Errorf("StackTrace(wrapped) is empty, want a captured stack")
+	}
+}
+
+func TestWrapPrependsMessage(t *testing.T) {
+	cause := errors.New("cause")
+	wrapped := Wrap(cause, "context")
+
+	if wrapped.Error() != "context: cause" {
+		t.Errorf("Error() = %q, want %q", wrapped.Error(), "context: cause")
+	}
+	if !errors.Is(wrapped, cause) {
+		t.Errorf("errors.Is(wrapped, cause) = false, want true")
+	}
+}
+
+type myError struct{ msg string }
+
+func (e *myError) Error() string { return e.msg }
+
+func TestErrorsAsThroughWrap(t *testing.T) {
+	cause := &myError{msg: "specific"}
+	wrapped := Wrap(cause, "context")
+
+	var target *myError
+	if !errors.As(wrapped, &target) {
+		t.Fatalf("errors.As(wrapped, &target) = false, want true")
+	}
+	if target != cause {
+		t.Errorf("errors.As resolved to %v, want %v", target, cause)
+	}
+}
+
+func TestStackTraceReturnsDeepestThroughNestedWraps(t *testing.T) {
+	inner := New("inner")
+	innerStack := StackTrace(inner)
+
+	outer := Wrap(Wrap(inner, "mid"), "outer")
+	outerStack := StackTrace(outer)
+
+	if len(outerStack) != len(innerStack) {
+		t.Fatalf("StackTrace(outer) has %d frames, want %d (the innermost capture)", len(outerStack), len(innerStack))
+	}
+	for i := range innerStack {
+		if fmt.Sprintf("%+v", outerStack[i]) != fmt.Sprintf("%+v", innerStack[i]) {
+			t.Errorf("frame %d = %+v, want %+v", i, outerStack[i], innerStack[i])
+		}
+	}
+}
+
+func TestStackTraceNilWithoutTracer(t *testing.T) {
+	if st := StackTrace(errors.New("plain")); st != nil {
+		t.Errorf("StackTrace(plain) = %v, want nil", st)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	err := New("boom")
+
+	if got := fmt.Sprintf("%v", err); got != "boom" {
+		t.Errorf("%%v = %q, want %q", got, "boom")
+	}
+	if got := fmt.Sprintf("%s", err); got != "boom" {
+		t.Errorf("%%s = %q, want %q", got, "boom")
+	}
+	if got := fmt.Sprintf("%q", err); got != `"boom"` {
+		t.Errorf("%%q = %q, want %q", got, `"boom"`)
+	}
+
+	plus := fmt.Sprintf("%+v", err)
+	if !strings.HasPrefix(plus, "boom\n") {
+		t.Errorf("%%+v = %q, want it to start with %q", plus, "boom\\n")
+	}
+	if strings.Count(plus, "\n") == 0 {
+		t.Errorf("%%+v = %q, want at least one stack frame line", plus)
+	}
+}